@@ -2,31 +2,237 @@ package s3Access
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/credentials/ssocreds"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/aws-sdk-go-v2/service/sso"
+	"github.com/aws/aws-sdk-go-v2/service/ssooidc"
+	"github.com/aws/smithy-go"
+	"github.com/manifoldco/promptui"
+	"golang.org/x/sync/errgroup"
+	"gopkg.in/ini.v1"
+
+	"s3_mp_janitor/report"
 )
 
+// ProfileConfig describes an AWS (or S3-compatible) profile as read from ~/.aws/config.
+// Endpoint/ForcePathStyle let the janitor target non-AWS S3 backends such as
+// MinIO, Ceph, or Wasabi, which accumulate the same abandoned multipart garbage.
+type ProfileConfig struct {
+	Name           string
+	Region         string
+	Endpoint       string
+	ForcePathStyle bool
+}
+
+// newS3Client builds an S3 client from cfg, defaulting the region when the profile doesn't set
+// one and only overriding the endpoint/path style when the profile points at a non-AWS backend.
+func newS3Client(cfg aws.Config, profile ProfileConfig) *s3.Client {
+	return s3.NewFromConfig(cfg, func(o *s3.Options) {
+		if profile.Region != "" {
+			o.Region = profile.Region
+		} else if o.Region == "" {
+			o.Region = "ap-southeast-2"
+		}
+		if profile.Endpoint != "" {
+			o.BaseEndpoint = aws.String(profile.Endpoint)
+			o.UsePathStyle = profile.ForcePathStyle
+		}
+	})
+}
+
+// cachedCredentials is the on-disk shape used to avoid re-prompting for MFA/SSO
+// on every invocation within the lifetime of the assumed-role/SSO session.
+type cachedCredentials struct {
+	AccessKeyID     string    `json:"access_key_id"`
+	SecretAccessKey string    `json:"secret_access_key"`
+	SessionToken    string    `json:"session_token"`
+	Expires         time.Time `json:"expires"`
+}
+
+// credentialCachePath returns the path the janitor caches temporary credentials
+// for profile under, e.g. ~/.aws/janitor-cache/<profile>.json.
+func credentialCachePath(profile string) string {
+	return filepath.Join(os.Getenv("HOME"), ".aws", "janitor-cache", profile+".json")
+}
+
+// loadCachedCredentials returns cached credentials for profile if present and not yet expired.
+func loadCachedCredentials(profile string) (*cachedCredentials, error) {
+	data, err := os.ReadFile(credentialCachePath(profile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var cached cachedCredentials
+	if err := json.Unmarshal(data, &cached); err != nil {
+		return nil, err
+	}
+
+	if time.Now().After(cached.Expires) {
+		return nil, nil
+	}
+
+	return &cached, nil
+}
+
+// saveCachedCredentials persists creds for profile so subsequent runs within
+// the session's lifetime don't need to re-prompt for MFA or re-authenticate SSO.
+func saveCachedCredentials(profile string, creds *cachedCredentials) error {
+	path := credentialCachePath(profile)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(creds)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, data, 0600)
+}
+
+// profileSection loads the named section (profile) out of ~/.aws/config,
+// accounting for the "profile <name>" heading the AWS CLI uses for
+// everything but the default profile. profile is accepted either as the
+// bare name (e.g. "minio-prod", the --profile convention) or already
+// carrying the "profile " heading, so callers can't double-prefix it.
+func profileSection(profile string) (*ini.Section, error) {
+	cfgPath := filepath.Join(os.Getenv("HOME"), ".aws", "config")
+	cfg, err := ini.Load(cfgPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config file: %v", err)
+	}
+
+	profile = strings.TrimPrefix(profile, "profile ")
+	sectionName := "profile " + profile
+	if profile == "default" {
+		sectionName = "default"
+	}
+
+	if !cfg.HasSection(sectionName) {
+		return nil, nil
+	}
+
+	return cfg.Section(sectionName), nil
+}
+
+// isSSOProfile reports whether section configures AWS Identity Center (SSO) login.
+func isSSOProfile(section *ini.Section) bool {
+	if section == nil {
+		return false
+	}
+	return section.HasKey("sso_start_url") && section.HasKey("sso_account_id") && section.HasKey("sso_role_name")
+}
+
+// mfaRoleDetails extracts the mfa_serial/role_arn pair used to assume a role
+// with MFA, returning ok=false if the profile isn't configured for it.
+func mfaRoleDetails(section *ini.Section) (serial string, roleArn string, ok bool) {
+	if section == nil || !section.HasKey("mfa_serial") || !section.HasKey("role_arn") {
+		return "", "", false
+	}
+	return section.Key("mfa_serial").String(), section.Key("role_arn").String(), true
+}
+
+// promptMFATOTP asks the user for their current MFA TOTP code.
+func promptMFATOTP(serial string) (string, error) {
+	prompt := promptui.Prompt{
+		Label: fmt.Sprintf("Enter MFA code for %s", serial),
+	}
+	return prompt.Run()
+}
+
 // LoadAWSConfigForProfile loads the AWS configuration for the given profile from the local AWS config and credentials files.
-func LoadAWSConfigForProfile(ctx context.Context, profile string) (aws.Config, error) {
+// It transparently upgrades to the SDK v2 SSO credential provider for profiles configured for AWS Identity Center, and
+// prompts for an MFA TOTP before assuming a role when the profile has mfa_serial/role_arn set. Resulting temporary
+// credentials are cached on disk so the janitor doesn't re-prompt on every run within the session's lifetime.
+// regionOverride, when non-empty (e.g. from the --region flag), takes precedence over the profile's configured region.
+func LoadAWSConfigForProfile(ctx context.Context, profile string, regionOverride string) (aws.Config, error) {
 	if profile == "" {
 		profile = "default"
 	}
 
-	cfg, err := config.LoadDefaultConfig(ctx, config.WithSharedConfigProfile(profile))
+	if cached, err := loadCachedCredentials(profile); err == nil && cached != nil {
+		cfg, cfgErr := config.LoadDefaultConfig(ctx,
+			config.WithRegion(regionOverride),
+			config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(cached.AccessKeyID, cached.SecretAccessKey, cached.SessionToken)),
+		)
+		if cfgErr == nil {
+			return cfg, nil
+		}
+	}
+
+	section, err := profileSection(profile)
+	if err != nil {
+		return aws.Config{}, err
+	}
+
+	cfgOpts := []func(*config.LoadOptions) error{config.WithSharedConfigProfile(profile)}
+	if regionOverride != "" {
+		cfgOpts = append(cfgOpts, config.WithRegion(regionOverride))
+	}
+
+	// The SDK's own shared-config resolver sees role_arn+mfa_serial on the profile and tries to
+	// build the assumed-role provider itself during LoadDefaultConfig; with no TokenProvider
+	// registered it fails fast with AssumeRoleTokenProviderNotSetError before the call even
+	// returns. Register the prompt up front instead of overwriting cfg.Credentials afterwards.
+	serial, _, mfaOk := mfaRoleDetails(section)
+	if mfaOk {
+		cfgOpts = append(cfgOpts, config.WithAssumeRoleCredentialOptions(func(o *stscreds.AssumeRoleOptions) {
+			o.TokenProvider = func() (string, error) {
+				return promptMFATOTP(serial)
+			}
+		}))
+	}
+
+	cfg, err := config.LoadDefaultConfig(ctx, cfgOpts...)
 	if err != nil {
 		return aws.Config{}, fmt.Errorf("failed to load AWS config for profile %s: %v", profile, err)
 	}
 
+	if isSSOProfile(section) {
+		ssoCfg, err := config.LoadDefaultConfig(ctx, config.WithSharedConfigProfile(profile))
+		if err != nil {
+			return aws.Config{}, fmt.Errorf("failed to load SSO config for profile %s: %v", profile, err)
+		}
+		cfg.Credentials = ssocreds.New(sso.NewFromConfig(ssoCfg), section.Key("sso_account_id").String(),
+			section.Key("sso_role_name").String(), section.Key("sso_start_url").String(),
+			func(o *ssocreds.Options) {
+				o.SSOTokenProvider = ssocreds.NewSSOTokenProvider(ssooidc.NewFromConfig(ssoCfg), filepath.Join(os.Getenv("HOME"), ".aws", "sso", "cache"))
+			})
+	}
+
+	if isSSOProfile(section) || mfaOk {
+		if creds, err := cfg.Credentials.Retrieve(ctx); err == nil {
+			saveCachedCredentials(profile, &cachedCredentials{
+				AccessKeyID:     creds.AccessKeyID,
+				SecretAccessKey: creds.SecretAccessKey,
+				SessionToken:    creds.SessionToken,
+				Expires:         creds.Expires,
+			})
+		}
+	}
+
 	return cfg, nil
 }
 
 // GetCredentialsForProfile retrieves the AWS credentials for the given profile from the loaded AWS configuration.
-func GetCredentialsForProfile(ctx context.Context, profile string) (*aws.Credentials, error) {
-	cfg, err := LoadAWSConfigForProfile(ctx, profile)
+func GetCredentialsForProfile(ctx context.Context, profile string, regionOverride string) (*aws.Credentials, error) {
+	cfg, err := LoadAWSConfigForProfile(ctx, profile, regionOverride)
 	if err != nil {
 		return nil, err
 	}
@@ -39,42 +245,67 @@ func GetCredentialsForProfile(ctx context.Context, profile string) (*aws.Credent
 	return &creds, nil
 }
 
-// ListS3Buckets: Lists all the S3 buckets associated with the AWS account of the given session.
-// sess : *session.Session : The active AWS session.
+// ListS3Buckets: Lists all the S3 buckets associated with the AWS account identified by cfg.
+// ctx : context.Context : Cancels the request.
+// cfg : aws.Config : The loaded AWS configuration, e.g. from LoadAWSConfigForProfile.
+// profile : ProfileConfig : The profile's region/endpoint settings, so non-AWS S3 backends are reachable.
 // return : ([]string, error) : A list of all S3 bucket names and error if any.
-func ListS3Buckets(sess *session.Session) ([]string, error) {
-	s3Svc := s3.New(sess, &aws.Config{Region: aws.String("ap-southeast-2")})
+func ListS3Buckets(ctx context.Context, cfg aws.Config, profile ProfileConfig) ([]string, error) {
+	s3Svc := newS3Client(cfg, profile)
 
-	result, err := s3Svc.ListBuckets(nil)
+	result, err := s3Svc.ListBuckets(ctx, &s3.ListBucketsInput{})
 	if err != nil {
 		return nil, err
 	}
 
 	bucketNames := make([]string, len(result.Buckets))
 	for i, b := range result.Buckets {
-		bucketNames[i] = *b.Name
+		bucketNames[i] = aws.ToString(b.Name)
 	}
 
 	return bucketNames, nil
 }
 
+// ScanOptions controls how the bucket/upload scan behaves.
+type ScanOptions struct {
+	// Concurrency is the number of uploads within a bucket processed in parallel; buckets are
+	// scanned one at a time. Defaults to 1 when <= 0.
+	Concurrency int
+	// OlderThan, when non-zero, skips uploads initiated more recently than this duration ago.
+	OlderThan time.Duration
+	// DryRun reports what would be aborted without calling AbortMultipartUpload.
+	DryRun bool
+}
+
+func (o ScanOptions) concurrency() int {
+	if o.Concurrency <= 0 {
+		return 1
+	}
+	return o.Concurrency
+}
+
 // AbortFailedMultipartUploadsInAllBuckets: Aborts or deletes any failed multipart uploads in all S3 buckets associated with the AWS account.
-// sess : *session.Session : The active AWS session.
+// ctx : context.Context : Cancels the scan; an in-flight abort/list call returns early when it fires.
+// cfg : aws.Config : The loaded AWS configuration, e.g. from LoadAWSConfigForProfile.
+// profile : ProfileConfig : The profile's region/endpoint settings, so non-AWS S3 backends are reachable.
+// opts : ScanOptions : Concurrency, age filter, and dry-run behaviour for the scan.
+// rep : *report.Report : Accumulates a Record for every upload seen, for later rendering/ingestion.
 // return : error : Any error that occurred during the process.
-func AbortFailedMultipartUploadsInAllBuckets(sess *session.Session) error {
-	s3Svc := s3.New(sess)
+func AbortFailedMultipartUploadsInAllBuckets(ctx context.Context, cfg aws.Config, profile ProfileConfig, opts ScanOptions, rep *report.Report) error {
+	s3Svc := newS3Client(cfg, profile)
 
-	// List all buckets
-	buckets, err := s3Svc.ListBuckets(nil)
+	buckets, err := s3Svc.ListBuckets(ctx, &s3.ListBucketsInput{})
 	if err != nil {
 		return fmt.Errorf("error listing buckets: %v", err)
 	}
 
-	// Loop over each bucket and abort in-progress multipart uploads
+	// Buckets are processed one at a time; opts.concurrency() bounds the per-upload workers
+	// inside AbortFailedMultipartUploadsInBucket instead. Bounding both levels independently
+	// would allow up to concurrency^2 simultaneous S3 calls instead of the documented N.
 	for _, bucket := range buckets.Buckets {
-		err := AbortFailedMultipartUploadsInBucket(sess, *bucket.Name)
-		if err != nil {
-			return fmt.Errorf("error aborting multipart uploads in bucket %s: %v", *bucket.Name, err)
+		bucketName := aws.ToString(bucket.Name)
+		if err := AbortFailedMultipartUploadsInBucket(ctx, cfg, profile, bucketName, opts, rep); err != nil {
+			return fmt.Errorf("error aborting multipart uploads in bucket %s: %v", bucketName, err)
 		}
 	}
 
@@ -82,33 +313,200 @@ func AbortFailedMultipartUploadsInAllBuckets(sess *session.Session) error {
 }
 
 // AbortFailedMultipartUploadsInBucket: Aborts or deletes any failed multipart uploads in a given S3 bucket.
-// sess : *session.Session : The active AWS session.
+// ctx : context.Context : Cancels the scan; an in-flight abort/list call returns early when it fires.
+// cfg : aws.Config : The loaded AWS configuration, e.g. from LoadAWSConfigForProfile.
+// profile : ProfileConfig : The profile's region/endpoint settings, so non-AWS S3 backends are reachable.
 // bucketName : string : The name of the S3 bucket to process.
+// opts : ScanOptions : Concurrency, age filter, and dry-run behaviour for the scan.
+// rep : *report.Report : Accumulates a Record for every upload seen, for later rendering/ingestion.
 // return : error : Any error that occurred during the process.
-func AbortFailedMultipartUploadsInBucket(sess *session.Session, bucketName string) error {
-	s3Svc := s3.New(sess)
+func AbortFailedMultipartUploadsInBucket(ctx context.Context, cfg aws.Config, profile ProfileConfig, bucketName string, opts ScanOptions, rep *report.Report) error {
+	s3Svc := newS3Client(cfg, profile)
 
-	// List all in-progress multipart uploads in the given bucket
-	uploads, err := s3Svc.ListMultipartUploads(&s3.ListMultipartUploadsInput{
-		Bucket: &bucketName,
-	})
+	var cutoff time.Time
+	if opts.OlderThan > 0 {
+		cutoff = time.Now().Add(-opts.OlderThan)
+	}
 
+	g, gCtx := errgroup.WithContext(ctx)
+	g.SetLimit(opts.concurrency())
+
+	paginator := s3.NewListMultipartUploadsPaginator(s3Svc, &s3.ListMultipartUploadsInput{Bucket: &bucketName})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(gCtx)
+		if err != nil {
+			return fmt.Errorf("error listing multipart uploads for bucket %s: %v", bucketName, err)
+		}
+
+		for _, upload := range page.Uploads {
+			upload := upload
+			g.Go(func() error {
+				rep.Add(processUpload(gCtx, s3Svc, profile.Name, bucketName, upload, cutoff, opts.DryRun))
+				return nil
+			})
+		}
+	}
+
+	return g.Wait()
+}
+
+// processUpload computes how much storage a multipart upload is holding, then aborts it unless
+// it's younger than cutoff or dryRun is set. It always returns a Record describing what happened
+// (or would have happened) to it.
+func processUpload(ctx context.Context, s3Svc *s3.Client, profileName, bucketName string, upload types.MultipartUpload, cutoff time.Time, dryRun bool) report.Record {
+	rec := report.Record{
+		Profile:   profileName,
+		Bucket:    bucketName,
+		Key:       aws.ToString(upload.Key),
+		UploadID:  aws.ToString(upload.UploadId),
+		Initiated: aws.ToTime(upload.Initiated),
+	}
+
+	partCount, bytesReclaimed, err := sumParts(ctx, s3Svc, bucketName, rec.Key, rec.UploadID)
 	if err != nil {
-		return fmt.Errorf("error listing multipart uploads for bucket %s: %v", bucketName, err)
+		rec.Status = report.StatusError
+		rec.Error = err.Error()
+		return rec
+	}
+	rec.PartCount = partCount
+	rec.BytesReclaimed = bytesReclaimed
+
+	if !cutoff.IsZero() && rec.Initiated.After(cutoff) {
+		rec.Status = report.StatusSkipped
+		return rec
+	}
+
+	if dryRun {
+		rec.Status = report.StatusWouldAbort
+		return rec
+	}
+
+	if _, err := s3Svc.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+		Bucket:   &bucketName,
+		Key:      upload.Key,
+		UploadId: upload.UploadId,
+	}); err != nil {
+		rec.Status = report.StatusError
+		rec.Error = err.Error()
+		return rec
 	}
 
-	// Loop over each multipart upload and abort them
-	for _, upload := range uploads.Uploads {
-		_, err := s3Svc.AbortMultipartUpload(&s3.AbortMultipartUploadInput{
-			Bucket:   &bucketName,
-			Key:      upload.Key,
-			UploadId: upload.UploadId,
-		})
+	rec.Status = report.StatusAborted
+	return rec
+}
+
+// sumParts lists every part already uploaded for a multipart upload and returns how many there
+// are and their total size, i.e. the storage that aborting the upload would reclaim.
+func sumParts(ctx context.Context, s3Svc *s3.Client, bucket, key, uploadID string) (int, int64, error) {
+	var count int
+	var total int64
 
+	paginator := s3.NewListPartsPaginator(s3Svc, &s3.ListPartsInput{
+		Bucket:   &bucket,
+		Key:      &key,
+		UploadId: &uploadID,
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
 		if err != nil {
-			return fmt.Errorf("error aborting multipart upload %s for key %s: %v", *upload.UploadId, *upload.Key, err)
+			return 0, 0, fmt.Errorf("error listing parts for upload %s: %v", uploadID, err)
+		}
+		for _, part := range page.Parts {
+			count++
+			total += aws.ToInt64(part.Size)
 		}
 	}
 
+	return count, total, nil
+}
+
+// janitorLifecycleRuleID identifies the lifecycle rule EnsureAbortIncompleteMultipartLifecycle
+// installs, so it can find and update its own rule without disturbing any others on the bucket.
+const janitorLifecycleRuleID = "s3-janitor-abort-incomplete-multipart-upload"
+
+// EnsureAbortIncompleteMultipartLifecycle installs (or updates) a bucket lifecycle rule that aborts
+// incomplete multipart uploads after days. Existing rules on the bucket are preserved; only the
+// janitor's own rule is replaced. This is the AWS-recommended permanent fix, pairing the one-off
+// abort the janitor performs with something that prevents the garbage from coming back.
+func EnsureAbortIncompleteMultipartLifecycle(ctx context.Context, cfg aws.Config, profile ProfileConfig, bucketName string, days int32) error {
+	s3Svc := newS3Client(cfg, profile)
+
+	rules, err := existingLifecycleRules(ctx, s3Svc, bucketName)
+	if err != nil {
+		return err
+	}
+
+	kept := []types.LifecycleRule{}
+	for _, rule := range rules {
+		if aws.ToString(rule.ID) != janitorLifecycleRuleID {
+			kept = append(kept, rule)
+		}
+	}
+
+	kept = append(kept, types.LifecycleRule{
+		ID:     aws.String(janitorLifecycleRuleID),
+		Status: types.ExpirationStatusEnabled,
+		Filter: &types.LifecycleRuleFilter{Prefix: aws.String("")},
+		AbortIncompleteMultipartUpload: &types.AbortIncompleteMultipartUpload{
+			DaysAfterInitiation: aws.Int32(days),
+		},
+	})
+
+	if _, err := s3Svc.PutBucketLifecycleConfiguration(ctx, &s3.PutBucketLifecycleConfigurationInput{
+		Bucket:                 &bucketName,
+		LifecycleConfiguration: &types.BucketLifecycleConfiguration{Rules: kept},
+	}); err != nil {
+		return fmt.Errorf("error installing lifecycle rule on bucket %s: %v", bucketName, err)
+	}
+
+	return nil
+}
+
+// RemoveAbortIncompleteMultipartLifecycle removes the janitor's own abort-incomplete-multipart-upload
+// lifecycle rule from bucketName, leaving any other rules on the bucket untouched.
+func RemoveAbortIncompleteMultipartLifecycle(ctx context.Context, cfg aws.Config, profile ProfileConfig, bucketName string) error {
+	s3Svc := newS3Client(cfg, profile)
+
+	rules, err := existingLifecycleRules(ctx, s3Svc, bucketName)
+	if err != nil {
+		return err
+	}
+
+	kept := []types.LifecycleRule{}
+	for _, rule := range rules {
+		if aws.ToString(rule.ID) != janitorLifecycleRuleID {
+			kept = append(kept, rule)
+		}
+	}
+
+	if len(kept) == 0 {
+		if _, err := s3Svc.DeleteBucketLifecycle(ctx, &s3.DeleteBucketLifecycleInput{Bucket: &bucketName}); err != nil {
+			return fmt.Errorf("error removing lifecycle configuration from bucket %s: %v", bucketName, err)
+		}
+		return nil
+	}
+
+	if _, err := s3Svc.PutBucketLifecycleConfiguration(ctx, &s3.PutBucketLifecycleConfigurationInput{
+		Bucket:                 &bucketName,
+		LifecycleConfiguration: &types.BucketLifecycleConfiguration{Rules: kept},
+	}); err != nil {
+		return fmt.Errorf("error updating lifecycle configuration on bucket %s: %v", bucketName, err)
+	}
+
 	return nil
 }
+
+// existingLifecycleRules fetches bucketName's current lifecycle rules, treating "no lifecycle
+// configuration" as zero rules rather than an error.
+func existingLifecycleRules(ctx context.Context, s3Svc *s3.Client, bucketName string) ([]types.LifecycleRule, error) {
+	out, err := s3Svc.GetBucketLifecycleConfiguration(ctx, &s3.GetBucketLifecycleConfigurationInput{Bucket: &bucketName})
+	if err != nil {
+		var apiErr smithy.APIError
+		if errors.As(err, &apiErr) && apiErr.ErrorCode() == "NoSuchLifecycleConfiguration" {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error reading lifecycle configuration for bucket %s: %v", bucketName, err)
+	}
+
+	return out.Rules, nil
+}
@@ -3,26 +3,31 @@ package config
 import (
 	"os"
 	"path/filepath"
-	"s3_mp_janitor/aws"
+	s3Access "s3_mp_janitor/aws"
+	"strings"
 
-	"github.com/aws/aws-sdk-go/aws/session"
 	"gopkg.in/ini.v1"
 )
 
 // ReadAWSConfigFile: Reads the AWS configuration file, typically located at `~/.aws/config`.
-// return : ([]aws.ProfileConfig, error) : A list of parsed AWS profiles and an error if any.
-func ReadAWSConfigFile() ([]aws.ProfileConfig, error) {
+// Profile names are normalized to the bare name (e.g. "minio-prod"), stripping the "profile "
+// heading the AWS CLI uses for everything but the default profile, so callers can compare
+// against the bare name they get from --profile or the interactive menu.
+// return : ([]s3Access.ProfileConfig, error) : A list of parsed AWS profiles and an error if any.
+func ReadAWSConfigFile() ([]s3Access.ProfileConfig, error) {
 	cfgPath := filepath.Join(os.Getenv("HOME"), ".aws", "config")
 	cfg, err := ini.Load(cfgPath)
 	if err != nil {
 		return nil, err
 	}
 
-	var profiles []aws.ProfileConfig
+	var profiles []s3Access.ProfileConfig
 	for _, section := range cfg.Sections() {
-		profile := aws.ProfileConfig{
-			Name:   section.Name(),
-			Region: section.Key("region").String(),
+		profile := s3Access.ProfileConfig{
+			Name:           strings.TrimPrefix(section.Name(), "profile "),
+			Region:         section.Key("region").String(),
+			Endpoint:       section.Key("s3_endpoint").String(),
+			ForcePathStyle: section.Key("s3_force_path_style").MustBool(false),
 		}
 		profiles = append(profiles, profile)
 	}
@@ -30,6 +35,23 @@ func ReadAWSConfigFile() ([]aws.ProfileConfig, error) {
 	return profiles, nil
 }
 
+// ProfileConfigByName looks up the parsed ProfileConfig for a single profile name,
+// as used to resolve the region/endpoint overrides for a given --profile.
+func ProfileConfigByName(profileName string) (s3Access.ProfileConfig, error) {
+	profiles, err := ReadAWSConfigFile()
+	if err != nil {
+		return s3Access.ProfileConfig{}, err
+	}
+
+	for _, profile := range profiles {
+		if profile.Name == profileName {
+			return profile, nil
+		}
+	}
+
+	return s3Access.ProfileConfig{Name: profileName}, nil
+}
+
 // RetrieveConfiguredProfiles: Retrieves the profiles (or accounts) listed in the AWS configuration.
 // return : []string : A list of profile names from the AWS configuration.
 func RetrieveConfiguredProfiles() ([]string, error) {
@@ -45,17 +67,3 @@ func RetrieveConfiguredProfiles() ([]string, error) {
 
 	return names, nil
 }
-
-// EstablishConnectionUsingProfile: Uses a specified profile from the AWS configuration to establish a connection or session.
-// profileName : string : The name of the AWS profile to use.
-// return : (*session.Session, error) : The AWS session established for the profile and error if any.
-func EstablishConnectionUsingProfile(profileName string) (*session.Session, error) {
-	sessOpts := session.Options{
-		Profile: profileName,
-	}
-	sess, err := session.NewSessionWithOptions(sessOpts)
-	if err != nil {
-		return nil, err
-	}
-	return sess, nil
-}
@@ -1,12 +1,15 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
 	s3Access "s3_mp_janitor/aws"
 	"s3_mp_janitor/config"
+	"s3_mp_janitor/report"
+	"strconv"
+	"time"
 
-	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/manifoldco/promptui"
 	"github.com/spf13/cobra"
 )
@@ -14,15 +17,84 @@ import (
 const allProfiles = "ALL_PROFILES"
 
 var (
-	discoverFlag bool
-	profileFlag  string
-	helpFlag     bool
+	discoverFlag         bool
+	profileFlag          string
+	bucketFlag           string
+	helpFlag             bool
+	endpointFlag         string
+	regionFlag           string
+	concurrencyFlag      int
+	olderThanFlag        time.Duration
+	dryRunFlag           bool
+	outputFlag           string
+	outputFileFlag       string
+	installLifecycleFlag int
 )
 
 func init() {
 	rootCmd.Flags().BoolVarP(&discoverFlag, "discover", "d", false, "Discover and manage failed S3 multipart uploads")
 	rootCmd.Flags().StringVarP(&profileFlag, "profile", "p", "", "AWS profile to use. If not specified, it will prompt interactively.")
+	rootCmd.Flags().StringVarP(&bucketFlag, "bucket", "b", "", "S3 bucket to target, or ALL_BUCKETS for every bucket in the profile. If not specified, it will prompt interactively.")
 	rootCmd.Flags().BoolVarP(&helpFlag, "help", "h", false, "Help page for the s3-janitor tool.")
+	rootCmd.Flags().StringVar(&endpointFlag, "endpoint", "", "S3-compatible endpoint to use (e.g. for MinIO/Ceph/Wasabi), overriding the profile's s3_endpoint setting.")
+	rootCmd.Flags().StringVar(&regionFlag, "region", "", "AWS region to use, overriding the profile's region setting.")
+	rootCmd.Flags().IntVar(&concurrencyFlag, "concurrency", 4, "Number of multipart uploads to process in parallel within a bucket; buckets are scanned one at a time.")
+	rootCmd.Flags().DurationVar(&olderThanFlag, "older-than", 0, "Only abort multipart uploads initiated longer ago than this (e.g. 24h). 0 disables the filter.")
+	rootCmd.Flags().BoolVar(&dryRunFlag, "dry-run", false, "Print what would be aborted without calling AbortMultipartUpload.")
+	rootCmd.Flags().StringVar(&outputFlag, "output", "table", "Report format: json, csv, or table.")
+	rootCmd.Flags().StringVar(&outputFileFlag, "output-file", "", "Write the report to this file instead of stdout.")
+	rootCmd.Flags().IntVar(&installLifecycleFlag, "install-lifecycle", 0, "Install an AbortIncompleteMultipartUpload lifecycle rule with this many days on the selected bucket(s), instead of aborting in-flight uploads. 0 disables.")
+}
+
+// scanOptionsFromFlags builds the ScanOptions for this invocation from the --concurrency/--older-than/--dry-run flags.
+func scanOptionsFromFlags() s3Access.ScanOptions {
+	return s3Access.ScanOptions{
+		Concurrency: concurrencyFlag,
+		OlderThan:   olderThanFlag,
+		DryRun:      dryRunFlag,
+	}
+}
+
+// writeReport renders rep in the --output format, to --output-file if set or stdout otherwise.
+func writeReport(rep *report.Report) error {
+	w := os.Stdout
+	if outputFileFlag != "" {
+		f, err := os.Create(outputFileFlag)
+		if err != nil {
+			return fmt.Errorf("error creating output file %s: %v", outputFileFlag, err)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	switch outputFlag {
+	case "json":
+		return rep.WriteJSON(w)
+	case "csv":
+		return rep.WriteCSV(w)
+	case "table":
+		return rep.WriteTable(w)
+	default:
+		return fmt.Errorf("unknown --output format %q (want json, csv, or table)", outputFlag)
+	}
+}
+
+// profileConfigFor resolves the profile's region/endpoint settings from ~/.aws/config,
+// applying the --endpoint/--region flags on top when set.
+func profileConfigFor(profile string) s3Access.ProfileConfig {
+	cfg, err := config.ProfileConfigByName(profile)
+	if err != nil {
+		cfg = s3Access.ProfileConfig{Name: profile}
+	}
+
+	if regionFlag != "" {
+		cfg.Region = regionFlag
+	}
+	if endpointFlag != "" {
+		cfg.Endpoint = endpointFlag
+	}
+
+	return cfg
 }
 
 var rootCmd = &cobra.Command{
@@ -55,35 +127,60 @@ func discover(cmd *cobra.Command, args []string) {
 		profileFlag = profile
 	}
 
-	credentials, credErr := s3Access.GetCredentialsForProfile(profileFlag)
-	if credErr != nil {
-		fmt.Printf("Error fetching credentials for %s: %v\n", profileFlag, credErr)
-		return
-	}
-	// Use these credentials to create the session
-	sess, err := s3Access.CreateAWSSessionWithCredentials(profileFlag, credentials) // Assuming you modify or create such a function in aws package
+	ctx := context.Background()
+	cfg, err := s3Access.LoadAWSConfigForProfile(ctx, profileFlag, regionFlag)
 	if err != nil {
-		fmt.Printf("Error creating session: %v\n", err)
+		fmt.Printf("Error loading AWS config for %s: %v\n", profileFlag, err)
 		return
 	}
 
-	bucket, err := GetBucketChoice(profileFlag)
-	if err != nil {
-		fmt.Printf("Error selecting bucket: %v\n", err)
-		return
-	}
+	profile := profileConfigFor(profileFlag)
 
-	if bucket == "ALL_BUCKETS" {
-		buckets, err := s3Access.ListS3Buckets(sess)
+	// Let --bucket select the target non-interactively (ALL_BUCKETS for every bucket in the
+	// profile), so --discover can run unattended from cron/CI instead of blocking on a prompt.
+	bucket := bucketFlag
+	if bucket == "" {
+		var err error
+		bucket, err = GetBucketChoice(profileFlag)
 		if err != nil {
-			fmt.Printf("Error retrieving buckets: %v\n", err)
+			fmt.Printf("Error selecting bucket: %v\n", err)
 			return
 		}
-		for _, b := range buckets {
-			printFailedUploads(sess, b)
+	}
+
+	if installLifecycleFlag > 0 {
+		var targetBuckets []string
+		if bucket == "ALL_BUCKETS" {
+			buckets, err := s3Access.ListS3Buckets(ctx, cfg, profile)
+			if err != nil {
+				fmt.Printf("Error retrieving buckets: %v\n", err)
+				return
+			}
+			targetBuckets = buckets
+		} else {
+			targetBuckets = []string{bucket}
+		}
+
+		for _, b := range targetBuckets {
+			if err := s3Access.EnsureAbortIncompleteMultipartLifecycle(ctx, cfg, profile, b, int32(installLifecycleFlag)); err != nil {
+				fmt.Printf("Error installing lifecycle rule on bucket %s: %v\n", b, err)
+			}
+		}
+		return
+	}
+
+	rep := report.New()
+	opts := scanOptionsFromFlags()
+	if bucket == "ALL_BUCKETS" {
+		if err := s3Access.AbortFailedMultipartUploadsInAllBuckets(ctx, cfg, profile, opts, rep); err != nil {
+			fmt.Printf("Error aborting multipart uploads: %v\n", err)
 		}
-	} else {
-		printFailedUploads(sess, bucket)
+	} else if err := s3Access.AbortFailedMultipartUploadsInBucket(ctx, cfg, profile, bucket, opts, rep); err != nil {
+		fmt.Printf("Error aborting multipart uploads in bucket %s: %v\n", bucket, err)
+	}
+
+	if err := writeReport(rep); err != nil {
+		fmt.Printf("Error writing report: %v\n", err)
 	}
 }
 
@@ -95,6 +192,7 @@ func menu() {
 			"Select the profile and bucket to expire",
 			"Select the profile and all buckets to expire",
 			"Expire all profiles and all buckets",
+			"Install lifecycle policy on selected bucket(s)",
 			"Exit",
 		}
 
@@ -119,16 +217,10 @@ func menu() {
 				continue // Takes the user back to the main menu
 			}
 
-			// Create session with profile
-			credentials, credErr := s3Access.GetCredentialsForProfile(profileFlag)
-			if credErr != nil {
-				fmt.Printf("Error fetching credentials for profile %s: %v\n", profileFlag, credErr)
-				return
-			}
-			// Use these credentials to create the session
-			sess, err := s3Access.CreateAWSSessionWithCredentials(profileFlag, credentials) // Assuming you modify or create such a function in aws package
+			ctx := context.Background()
+			cfg, err := s3Access.LoadAWSConfigForProfile(ctx, profile, regionFlag)
 			if err != nil {
-				fmt.Printf("Error creating session: %v\n", err)
+				fmt.Printf("Error loading AWS config for %s: %v\n", profile, err)
 				return
 			}
 
@@ -143,11 +235,15 @@ func menu() {
 			fmt.Printf("You chose profile: %s and bucket: %s\n", profile, bucket)
 
 			// Purge in bucket
-			err = s3Access.AbortFailedMultipartUploadsInBucket(sess, bucket)
+			rep := report.New()
+			err = s3Access.AbortFailedMultipartUploadsInBucket(ctx, cfg, profileConfigFor(profile), bucket, scanOptionsFromFlags(), rep)
 			if err != nil {
 				fmt.Printf("Error occurred expiring multipart uploads in bucket %v, %v\n", bucket, err)
 				continue // Takes the user back to the main menu
 			}
+			if err := writeReport(rep); err != nil {
+				fmt.Printf("Error writing report: %v\n", err)
+			}
 
 		case "Select the profile and all buckets to expire":
 			profile, err := GetProfileChoice()
@@ -161,6 +257,44 @@ func menu() {
 		case "Expire all profiles and all buckets":
 			// Further processing
 
+		case "Install lifecycle policy on selected bucket(s)":
+			profile, err := GetProfileChoice()
+			if err != nil {
+				fmt.Printf("Error selecting profile: %v\n", err)
+				continue // Takes the user back to the main menu
+			}
+
+			bucket, err := GetBucketChoice(profile)
+			if err != nil {
+				fmt.Printf("Error selecting bucket: %v\n", err)
+				continue // Takes the user back to the main menu
+			}
+
+			daysPrompt := promptui.Prompt{Label: "Abort incomplete multipart uploads after how many days"}
+			daysStr, err := daysPrompt.Run()
+			if err != nil {
+				fmt.Printf("Error reading days: %v\n", err)
+				continue // Takes the user back to the main menu
+			}
+			days, err := strconv.ParseInt(daysStr, 10, 32)
+			if err != nil {
+				fmt.Printf("Invalid number of days %q: %v\n", daysStr, err)
+				continue // Takes the user back to the main menu
+			}
+
+			ctx := context.Background()
+			cfg, err := s3Access.LoadAWSConfigForProfile(ctx, profile, regionFlag)
+			if err != nil {
+				fmt.Printf("Error loading AWS config for %s: %v\n", profile, err)
+				continue // Takes the user back to the main menu
+			}
+
+			if err := s3Access.EnsureAbortIncompleteMultipartLifecycle(ctx, cfg, profileConfigFor(profile), bucket, int32(days)); err != nil {
+				fmt.Printf("Error installing lifecycle rule on bucket %s: %v\n", bucket, err)
+				continue // Takes the user back to the main menu
+			}
+			fmt.Printf("Installed lifecycle rule on bucket %s: abort incomplete multipart uploads after %d day(s)\n", bucket, days)
+
 		case "Exit":
 			fmt.Println("Exiting...")
 			return // Exits the for loop and the program
@@ -192,13 +326,13 @@ func GetProfileChoice() (string, error) {
 // profile : string : The selected AWS profile name.
 // return : (string, error) : The selected S3 bucket name and error if any.
 func GetBucketChoice(profile string) (string, error) {
-	// Create a session using the selected profile
-	session, err := config.EstablishConnectionUsingProfile(profile)
+	ctx := context.Background()
+	cfg, err := s3Access.LoadAWSConfigForProfile(ctx, profile, regionFlag)
 	if err != nil {
 		return "", err
 	}
 
-	buckets, err := s3Access.ListS3Buckets(session)
+	buckets, err := s3Access.ListS3Buckets(ctx, cfg, profileConfigFor(profile))
 	if err != nil {
 		return "", err
 	}
@@ -215,11 +349,6 @@ func GetBucketChoice(profile string) (string, error) {
 	return result, nil
 }
 
-func printFailedUploads(sess *session.Session, bucketName string) {
-	// Call AbortFailedMultipartUploadsInBucket or another method to display the failed uploads
-	// For now, it's a dummy print to demonstrate
-	fmt.Println("Failed uploads for bucket:", bucketName)
-}
 
 // main initializes the CLI and handles command execution.
 func main() {
@@ -0,0 +1,137 @@
+// Package report collects and renders the audit trail of a janitor run, so the
+// tool can be driven from cron/CI and its output ingested by log pipelines.
+package report
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Status is the outcome recorded for a single multipart upload in a Report.
+type Status string
+
+const (
+	StatusAborted    Status = "aborted"
+	StatusWouldAbort Status = "would_abort"
+	StatusSkipped    Status = "skipped"
+	StatusError      Status = "error"
+)
+
+// Record is a single multipart upload's audit trail: what it was, what happened to it, and
+// how much incomplete-upload storage aborting it reclaimed. S3 bills storage on incomplete
+// multipart parts, so BytesReclaimed is usually the number users actually want to see.
+type Record struct {
+	Profile        string
+	Bucket         string
+	Key            string
+	UploadID       string
+	Initiated      time.Time
+	PartCount      int
+	BytesReclaimed int64
+	Status         Status
+	Error          string
+}
+
+// Report accumulates Records across one or more buckets/profiles for a single janitor run.
+// Add is safe to call concurrently, since uploads are scanned with a worker pool.
+type Report struct {
+	mu      sync.Mutex
+	Records []Record
+}
+
+// New returns an empty Report ready to be shared across concurrent scans.
+func New() *Report {
+	return &Report{}
+}
+
+// Add appends rec to the report.
+func (r *Report) Add(rec Record) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Records = append(r.Records, rec)
+}
+
+// Counts summarises how many records ended up in each status.
+func (r *Report) Counts() (aborted, wouldAbort, skipped, errored int) {
+	for _, rec := range r.Records {
+		switch rec.Status {
+		case StatusAborted:
+			aborted++
+		case StatusWouldAbort:
+			wouldAbort++
+		case StatusSkipped:
+			skipped++
+		case StatusError:
+			errored++
+		}
+	}
+	return aborted, wouldAbort, skipped, errored
+}
+
+// BytesReclaimed sums BytesReclaimed across every aborted record, or every record a --dry-run
+// would have aborted.
+func (r *Report) BytesReclaimed() int64 {
+	var total int64
+	for _, rec := range r.Records {
+		if rec.Status == StatusAborted || rec.Status == StatusWouldAbort {
+			total += rec.BytesReclaimed
+		}
+	}
+	return total
+}
+
+// WriteJSON renders the report as a JSON array of records.
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r.Records)
+}
+
+// WriteCSV renders the report as CSV, one row per record.
+func (r *Report) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	defer cw.Flush()
+
+	header := []string{"profile", "bucket", "key", "upload_id", "initiated", "part_count", "bytes_reclaimed", "status", "error"}
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+
+	for _, rec := range r.Records {
+		row := []string{
+			rec.Profile,
+			rec.Bucket,
+			rec.Key,
+			rec.UploadID,
+			rec.Initiated.Format(time.RFC3339),
+			strconv.Itoa(rec.PartCount),
+			strconv.FormatInt(rec.BytesReclaimed, 10),
+			string(rec.Status),
+			rec.Error,
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// WriteTable renders the report as a human-readable summary table, as shown at the end of an
+// interactive run.
+func (r *Report) WriteTable(w io.Writer) error {
+	for _, rec := range r.Records {
+		if _, err := fmt.Fprintf(w, "%-8s %-24s %-40s %-12d %s\n", rec.Status, rec.Bucket, rec.Key, rec.BytesReclaimed, rec.UploadID); err != nil {
+			return err
+		}
+	}
+
+	aborted, wouldAbort, skipped, errored := r.Counts()
+	_, err := fmt.Fprintf(w, "\n%d aborted, %d would be aborted, %d skipped, %d errored, %d bytes reclaimed\n", aborted, wouldAbort, skipped, errored, r.BytesReclaimed())
+	return err
+}